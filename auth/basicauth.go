@@ -0,0 +1,277 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/base64"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// NewStaticAuthenticator returns an Authenticator whose
+// GetUserFromRequest always returns user, regardless of the request
+// passed in. It is used by NewBasicAuthHandler (and by any other
+// middleware that validates credentials itself rather than parsing
+// them out of the request) to attach the already-resolved user to the
+// context, so that downstream NewAccessRequirement and
+// NewRequireAuthHandler, which call GetUserFromRequest rather than
+// reading auth.GetUser directly, still see it.
+func NewStaticAuthenticator(user User) Authenticator {
+	return &staticAuthenticator{user: user}
+}
+
+type staticAuthenticator struct {
+	user User
+}
+
+func (a *staticAuthenticator) GetUserFromRequest(_ UserManager, _ *http.Request) (User, error) {
+	if a.user == nil {
+		return nil, errors.New("no authenticated user")
+	}
+
+	return a.user, nil
+}
+
+func (a *staticAuthenticator) CheckAuthenticated(user User) bool { return user != nil }
+
+func (a *staticAuthenticator) CheckGroupAccess(user User, role string) bool {
+	if user == nil {
+		return false
+	}
+
+	for _, r := range user.Roles() {
+		if r == role {
+			return true
+		}
+	}
+
+	return false
+}
+
+// BasicAuthStore validates HTTP Basic Auth credentials against some
+// backing store of users and password hashes. Implementations are
+// free to use whatever hashing scheme they like; Validate is
+// responsible for recognizing the stored format and comparing it
+// against the supplied password.
+type BasicAuthStore interface {
+	// Validate reports whether username/password is a valid
+	// combination. It returns an error only when validation itself
+	// could not be performed (e.g. the backing store could not be
+	// read); unknown users or bad passwords simply return false with
+	// a nil error.
+	Validate(username, password string) (bool, error)
+}
+
+// MemoryBasicAuthStore is a BasicAuthStore backed by an in-memory map
+// of username to password hash. Hashes use the same encodings as an
+// htpasswd file entry (bcrypt, APR1, or legacy SHA1).
+type MemoryBasicAuthStore struct {
+	mu    sync.RWMutex
+	users map[string]string
+}
+
+// NewMemoryBasicAuthStore returns a BasicAuthStore populated from the
+// given username/hash pairs.
+func NewMemoryBasicAuthStore(users map[string]string) *MemoryBasicAuthStore {
+	store := &MemoryBasicAuthStore{users: make(map[string]string, len(users))}
+	for user, hash := range users {
+		store.users[user] = hash
+	}
+
+	return store
+}
+
+// SetUser adds or replaces the password hash for a user.
+func (s *MemoryBasicAuthStore) SetUser(username, hash string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.users[username] = hash
+}
+
+func (s *MemoryBasicAuthStore) Validate(username, password string) (bool, error) {
+	s.mu.RLock()
+	hash, ok := s.users[username]
+	s.mu.RUnlock()
+	if !ok {
+		return false, nil
+	}
+
+	return checkHtpasswdHash(hash, password)
+}
+
+// HTPasswdFileStore is a BasicAuthStore backed by a file in the
+// standard Apache htpasswd format, supporting bcrypt ($2a$/$2b$/$2y$),
+// APR1 ($apr1$), and legacy SHA1 ({SHA}) hashes. The file is parsed
+// once at construction and cached in memory; call Reload to pick up
+// changes made on disk afterward.
+type HTPasswdFileStore struct {
+	path string
+
+	mu    sync.RWMutex
+	users map[string]string
+}
+
+// NewHTPasswdFileStore reads path and returns a store backed by its
+// contents.
+func NewHTPasswdFileStore(path string) (*HTPasswdFileStore, error) {
+	store := &HTPasswdFileStore{path: path}
+	if err := store.Reload(); err != nil {
+		return nil, errors.Wrapf(err, "reading htpasswd file '%s'", path)
+	}
+
+	return store, nil
+}
+
+// Reload re-reads the underlying htpasswd file from disk.
+func (s *HTPasswdFileStore) Reload() error {
+	f, err := os.Open(s.path)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer f.Close()
+
+	users := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		users[parts[0]] = parts[1]
+	}
+	if err := scanner.Err(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	s.mu.Lock()
+	s.users = users
+	s.mu.Unlock()
+
+	return nil
+}
+
+func (s *HTPasswdFileStore) Validate(username, password string) (bool, error) {
+	s.mu.RLock()
+	hash, ok := s.users[username]
+	s.mu.RUnlock()
+	if !ok {
+		return false, nil
+	}
+
+	return checkHtpasswdHash(hash, password)
+}
+
+// checkHtpasswdHash validates password against an htpasswd-style hash,
+// dispatching on its prefix.
+func checkHtpasswdHash(hash, password string) (bool, error) {
+	switch {
+	case strings.HasPrefix(hash, "$2a$"), strings.HasPrefix(hash, "$2b$"), strings.HasPrefix(hash, "$2y$"):
+		if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil {
+			return false, nil
+		}
+		return true, nil
+	case strings.HasPrefix(hash, "$apr1$"):
+		return apr1Hash(password, hash) == hash, nil
+	case strings.HasPrefix(hash, "{SHA}"):
+		sum := sha1.Sum([]byte(password))
+		return "{SHA}"+base64.StdEncoding.EncodeToString(sum[:]) == hash, nil
+	default:
+		return false, errors.New("unrecognized htpasswd hash format")
+	}
+}
+
+// apr1Hash computes the APR1 (modified MD5 crypt) digest of password
+// using the salt embedded in existingHash, which is expected to be of
+// the form "$apr1$salt$digest".
+func apr1Hash(password, existingHash string) string {
+	parts := strings.SplitN(existingHash, "$", 4)
+	if len(parts) != 4 {
+		return ""
+	}
+	salt := parts[2]
+
+	ctx := md5.New()
+	ctx.Write([]byte(password))
+	ctx.Write([]byte("$apr1$"))
+	ctx.Write([]byte(salt))
+
+	altCtx := md5.New()
+	altCtx.Write([]byte(password))
+	altCtx.Write([]byte(salt))
+	altCtx.Write([]byte(password))
+	alt := altCtx.Sum(nil)
+
+	for i := len(password); i > 0; i -= 16 {
+		if i > 16 {
+			ctx.Write(alt)
+		} else {
+			ctx.Write(alt[:i])
+		}
+	}
+
+	for i := len(password); i != 0; i >>= 1 {
+		if i&1 != 0 {
+			ctx.Write([]byte{0})
+		} else {
+			ctx.Write([]byte(password[:1]))
+		}
+	}
+	final := ctx.Sum(nil)
+
+	for i := 0; i < 1000; i++ {
+		round := md5.New()
+		if i&1 != 0 {
+			round.Write([]byte(password))
+		} else {
+			round.Write(final)
+		}
+		if i%3 != 0 {
+			round.Write([]byte(salt))
+		}
+		if i%7 != 0 {
+			round.Write([]byte(password))
+		}
+		if i&1 != 0 {
+			round.Write(final)
+		} else {
+			round.Write([]byte(password))
+		}
+		final = round.Sum(nil)
+	}
+
+	const itoa64 = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+	var out strings.Builder
+	out.WriteString("$apr1$")
+	out.WriteString(salt)
+	out.WriteByte('$')
+
+	encode := func(b2, b1, b0 byte, n int) {
+		v := uint32(b2)<<16 | uint32(b1)<<8 | uint32(b0)
+		for i := 0; i < n; i++ {
+			out.WriteByte(itoa64[v&0x3f])
+			v >>= 6
+		}
+	}
+
+	encode(final[0], final[6], final[12], 4)
+	encode(final[1], final[7], final[13], 4)
+	encode(final[2], final[8], final[14], 4)
+	encode(final[3], final[9], final[15], 4)
+	encode(final[4], final[10], final[5], 4)
+	encode(0, 0, final[11], 2)
+
+	return out.String()
+}
@@ -0,0 +1,129 @@
+package auth
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestCheckHtpasswdHashBcrypt(t *testing.T) {
+	assert := assert.New(t)
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("hunter2"), bcrypt.DefaultCost)
+	assert.NoError(err)
+
+	ok, err := checkHtpasswdHash(string(hash), "hunter2")
+	assert.NoError(err)
+	assert.True(ok)
+
+	ok, err = checkHtpasswdHash(string(hash), "wrong")
+	assert.NoError(err)
+	assert.False(ok)
+}
+
+func TestCheckHtpasswdHashSHA(t *testing.T) {
+	assert := assert.New(t)
+
+	sum := sha1.Sum([]byte("hunter2"))
+	hash := "{SHA}" + base64.StdEncoding.EncodeToString(sum[:])
+
+	ok, err := checkHtpasswdHash(hash, "hunter2")
+	assert.NoError(err)
+	assert.True(ok)
+
+	ok, err = checkHtpasswdHash(hash, "wrong")
+	assert.NoError(err)
+	assert.False(ok)
+}
+
+func TestCheckHtpasswdHashAPR1(t *testing.T) {
+	assert := assert.New(t)
+
+	hash := apr1Hash("hunter2", "$apr1$saltsalt$")
+
+	ok, err := checkHtpasswdHash(hash, "hunter2")
+	assert.NoError(err)
+	assert.True(ok)
+
+	ok, err = checkHtpasswdHash(hash, "wrong")
+	assert.NoError(err)
+	assert.False(ok)
+}
+
+func TestCheckHtpasswdHashUnrecognized(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := checkHtpasswdHash("not-a-real-hash", "hunter2")
+	assert.Error(err)
+}
+
+func TestMemoryBasicAuthStore(t *testing.T) {
+	assert := assert.New(t)
+
+	sum := sha1.Sum([]byte("hunter2"))
+	hash := "{SHA}" + base64.StdEncoding.EncodeToString(sum[:])
+
+	store := NewMemoryBasicAuthStore(map[string]string{"alice": hash})
+
+	ok, err := store.Validate("alice", "hunter2")
+	assert.NoError(err)
+	assert.True(ok)
+
+	ok, err = store.Validate("alice", "wrong")
+	assert.NoError(err)
+	assert.False(ok)
+
+	ok, err = store.Validate("bob", "hunter2")
+	assert.NoError(err)
+	assert.False(ok)
+
+	store.SetUser("bob", hash)
+	ok, err = store.Validate("bob", "hunter2")
+	assert.NoError(err)
+	assert.True(ok)
+}
+
+func TestHTPasswdFileStore(t *testing.T) {
+	assert := assert.New(t)
+
+	sum := sha1.Sum([]byte("hunter2"))
+	hash := "{SHA}" + base64.StdEncoding.EncodeToString(sum[:])
+
+	path := filepath.Join(t.TempDir(), "htpasswd")
+	assert.NoError(os.WriteFile(path, []byte("# comment\nalice:"+hash+"\n\n"), 0600))
+
+	store, err := NewHTPasswdFileStore(path)
+	assert.NoError(err)
+
+	ok, err := store.Validate("alice", "hunter2")
+	assert.NoError(err)
+	assert.True(ok)
+
+	_, err = NewHTPasswdFileStore(filepath.Join(t.TempDir(), "missing"))
+	assert.Error(err)
+}
+
+func TestStaticAuthenticator(t *testing.T) {
+	assert := assert.New(t)
+
+	user := &oidcUser{Name: "alice", UserRoles: []string{"admin"}}
+	authenticator := NewStaticAuthenticator(user)
+
+	got, err := authenticator.GetUserFromRequest(nil, nil)
+	assert.NoError(err)
+	assert.Equal(user, got)
+
+	assert.True(authenticator.CheckAuthenticated(user))
+	assert.False(authenticator.CheckAuthenticated(nil))
+	assert.True(authenticator.CheckGroupAccess(user, "admin"))
+	assert.False(authenticator.CheckGroupAccess(user, "viewer"))
+
+	empty := NewStaticAuthenticator(nil)
+	_, err = empty.GetUserFromRequest(nil, nil)
+	assert.Error(err)
+}
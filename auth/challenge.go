@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"context"
+	"sync"
+)
+
+// Challenge describes a single WWW-Authenticate challenge: the
+// Authorization scheme it applies to (e.g. "Bearer", "Basic") and any
+// parameters (realm, scope, service, ...) to surface in the header.
+type Challenge struct {
+	Scheme string
+	Realm  string
+	Params map[string]string
+}
+
+// ChallengeNegotiator selects which registered auth.Provider should
+// handle a request, dispatching on the scheme named in its
+// Authorization header, and reports the combined set of challenges to
+// offer back when no provider accepted the request.
+type ChallengeNegotiator interface {
+	// ProviderForScheme returns the Provider registered for scheme
+	// (compared case-insensitively against the token read from the
+	// Authorization header, e.g. "Bearer"), and whether one is
+	// registered.
+	ProviderForScheme(scheme string) (Provider, bool)
+
+	// Challenges returns the challenge to offer for every registered
+	// scheme, in registration order.
+	Challenges() []Challenge
+}
+
+// SchemeNegotiator is the default ChallengeNegotiator. Providers are
+// registered under a scheme name and dispatched to by exact,
+// case-insensitive match against the Authorization header's scheme
+// token.
+type SchemeNegotiator struct {
+	mu         sync.RWMutex
+	order      []string
+	providers  map[string]Provider
+	challenges map[string]Challenge
+}
+
+// NewSchemeNegotiator returns an empty SchemeNegotiator.
+func NewSchemeNegotiator() *SchemeNegotiator {
+	return &SchemeNegotiator{
+		providers:  map[string]Provider{},
+		challenges: map[string]Challenge{},
+	}
+}
+
+// Register associates provider and challenge with scheme, replacing
+// any provider previously registered under the same name.
+func (n *SchemeNegotiator) Register(scheme string, provider Provider, challenge Challenge) {
+	key := normalizeScheme(scheme)
+	challenge.Scheme = scheme
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if _, ok := n.providers[key]; !ok {
+		n.order = append(n.order, key)
+	}
+	n.providers[key] = provider
+	n.challenges[key] = challenge
+}
+
+func (n *SchemeNegotiator) ProviderForScheme(scheme string) (Provider, bool) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	p, ok := n.providers[normalizeScheme(scheme)]
+	return p, ok
+}
+
+func (n *SchemeNegotiator) Challenges() []Challenge {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	out := make([]Challenge, 0, len(n.order))
+	for _, scheme := range n.order {
+		out = append(out, n.challenges[scheme])
+	}
+
+	return out
+}
+
+func normalizeScheme(scheme string) string {
+	out := make([]byte, len(scheme))
+	for i := 0; i < len(scheme); i++ {
+		c := scheme[i]
+		if c >= 'A' && c <= 'Z' {
+			c += 'a' - 'A'
+		}
+		out[i] = c
+	}
+
+	return string(out)
+}
+
+type challengeNegotiatorCtxKey int
+
+const challengeNegotiatorKey challengeNegotiatorCtxKey = 0
+
+// SetChallengeNegotiator attaches negotiator to ctx for later
+// retrieval with GetChallengeNegotiator.
+func SetChallengeNegotiator(ctx context.Context, negotiator ChallengeNegotiator) context.Context {
+	return context.WithValue(ctx, challengeNegotiatorKey, negotiator)
+}
+
+// GetChallengeNegotiator returns the ChallengeNegotiator attached to
+// ctx by SetChallengeNegotiator, if any.
+func GetChallengeNegotiator(ctx context.Context) (ChallengeNegotiator, bool) {
+	negotiator, ok := ctx.Value(challengeNegotiatorKey).(ChallengeNegotiator)
+	return negotiator, ok
+}
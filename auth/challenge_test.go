@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSchemeNegotiatorDispatchIsCaseInsensitive(t *testing.T) {
+	assert := assert.New(t)
+
+	n := NewSchemeNegotiator()
+	n.Register("Bearer", nil, Challenge{Realm: "api"})
+	n.Register("Basic", nil, Challenge{Realm: "api"})
+
+	_, ok := n.ProviderForScheme("bearer")
+	assert.True(ok)
+	_, ok = n.ProviderForScheme("BASIC")
+	assert.True(ok)
+	_, ok = n.ProviderForScheme("digest")
+	assert.False(ok)
+}
+
+func TestSchemeNegotiatorChallengesPreservesRegistrationOrder(t *testing.T) {
+	assert := assert.New(t)
+
+	n := NewSchemeNegotiator()
+	n.Register("Bearer", nil, Challenge{Realm: "api"})
+	n.Register("Basic", nil, Challenge{Realm: "api"})
+
+	challenges := n.Challenges()
+	if assert.Len(challenges, 2) {
+		assert.Equal("Bearer", challenges[0].Scheme)
+		assert.Equal("Basic", challenges[1].Scheme)
+	}
+}
+
+func TestChallengeNegotiatorContext(t *testing.T) {
+	assert := assert.New(t)
+
+	ctx := context.Background()
+	_, ok := GetChallengeNegotiator(ctx)
+	assert.False(ok)
+
+	n := NewSchemeNegotiator()
+	ctx = SetChallengeNegotiator(ctx, n)
+
+	got, ok := GetChallengeNegotiator(ctx)
+	assert.True(ok)
+	assert.Equal(n, got)
+}
@@ -0,0 +1,240 @@
+package auth
+
+import (
+	"encoding/json"
+	"net"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Effect is the outcome a Policy applies when it matches a request.
+type Effect string
+
+const (
+	// Allow permits a request matched by the policy.
+	Allow Effect = "allow"
+	// Deny rejects a request matched by the policy, overriding any
+	// Allow policy matched earlier in evaluation.
+	Deny Effect = "deny"
+)
+
+// Condition further restricts when a Policy applies, beyond the
+// subject/resource/action match.
+type Condition struct {
+	// IPRange, when set, requires the request's remote address to
+	// fall within this CIDR block.
+	IPRange string `json:"ip_range,omitempty"`
+
+	// StartHour and EndHour restrict the policy to matching only
+	// during this UTC hour-of-day window (0-23, inclusive of
+	// StartHour, exclusive of EndHour). The window is ignored when
+	// EndHour is zero.
+	StartHour int `json:"start_hour,omitempty"`
+	EndHour   int `json:"end_hour,omitempty"`
+}
+
+// Policy is a single access control rule. A request is matched when
+// its subject (the authenticated user's username or one of their
+// roles), resource (typically the request path), and action
+// (typically the HTTP method) each match one of the policy's patterns
+// and, if present, Condition is satisfied; "*" and path.Match-style
+// glob patterns are both supported, and a pattern ending in "/*" or
+// "/**" (e.g. "/api/*") matches the whole resource tree under that
+// prefix rather than a single path segment. Effect then determines
+// whether a matching request is allowed or denied.
+type Policy struct {
+	ID        string     `json:"id"`
+	Subjects  []string   `json:"subjects"`
+	Resources []string   `json:"resources"`
+	Actions   []string   `json:"actions"`
+	Effect    Effect     `json:"effect"`
+	Condition *Condition `json:"condition,omitempty"`
+}
+
+// Matches reports whether the policy applies to a request. subjects
+// is the set of identifiers to test against the policy's Subjects
+// patterns (typically the user's username and roles); remoteAddr and
+// now are used to evaluate Condition, if any.
+func (p *Policy) Matches(subjects []string, resource, action, remoteAddr string, now time.Time) bool {
+	if !matchesAnyOf(p.Subjects, subjects) {
+		return false
+	}
+	if !matchesAny(p.Resources, resource) {
+		return false
+	}
+	if !matchesAny(p.Actions, action) {
+		return false
+	}
+
+	return p.conditionSatisfied(remoteAddr, now)
+}
+
+func (p *Policy) conditionSatisfied(remoteAddr string, now time.Time) bool {
+	if p.Condition == nil {
+		return true
+	}
+
+	if p.Condition.IPRange != "" {
+		_, ipnet, err := net.ParseCIDR(p.Condition.IPRange)
+		if err != nil || !ipnet.Contains(net.ParseIP(stripPort(remoteAddr))) {
+			return false
+		}
+	}
+
+	if p.Condition.EndHour != 0 {
+		hour := now.UTC().Hour()
+		if hour < p.Condition.StartHour || hour >= p.Condition.EndHour {
+			return false
+		}
+	}
+
+	return true
+}
+
+func matchesAnyOf(patterns, values []string) bool {
+	for _, value := range values {
+		if matchesAny(patterns, value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func matchesAny(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		if pattern == "*" {
+			return true
+		}
+		if prefix, ok := globTreePrefix(pattern); ok {
+			if value == prefix || strings.HasPrefix(value, prefix+"/") {
+				return true
+			}
+			continue
+		}
+		if ok, err := path.Match(pattern, value); err == nil && ok {
+			return true
+		}
+		if strings.EqualFold(pattern, value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// globTreePrefix reports whether pattern ends in a trailing "/*" or
+// "/**" segment, which, unlike a bare path.Match "*", is treated as
+// matching the rest of the resource tree under it rather than a single
+// path segment (path.Match's "*" never crosses a "/"). ok is false for
+// any other pattern, which is matched with path.Match instead.
+func globTreePrefix(pattern string) (prefix string, ok bool) {
+	if strings.HasSuffix(pattern, "/**") {
+		return strings.TrimSuffix(pattern, "/**"), true
+	}
+	if strings.HasSuffix(pattern, "/*") {
+		return strings.TrimSuffix(pattern, "/*"), true
+	}
+
+	return "", false
+}
+
+func stripPort(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+
+	return addr
+}
+
+// PolicyStore resolves the set of Policy objects to evaluate for a
+// request.
+type PolicyStore interface {
+	Policies() ([]Policy, error)
+}
+
+// MemoryPolicyStore is a PolicyStore backed by a static, in-memory
+// list of policies.
+type MemoryPolicyStore struct {
+	mu       sync.RWMutex
+	policies []Policy
+}
+
+// NewMemoryPolicyStore returns a PolicyStore populated with policies.
+func NewMemoryPolicyStore(policies []Policy) *MemoryPolicyStore {
+	return &MemoryPolicyStore{policies: policies}
+}
+
+// SetPolicies replaces the store's policy set.
+func (s *MemoryPolicyStore) SetPolicies(policies []Policy) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.policies = policies
+}
+
+func (s *MemoryPolicyStore) Policies() ([]Policy, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	out := make([]Policy, len(s.policies))
+	copy(out, s.policies)
+
+	return out, nil
+}
+
+// JSONFilePolicyStore is a PolicyStore backed by a JSON file
+// containing an array of Policy objects. The file is parsed once at
+// construction; call Reload to pick up changes made on disk
+// afterward.
+type JSONFilePolicyStore struct {
+	path string
+
+	mu       sync.RWMutex
+	policies []Policy
+}
+
+// NewJSONFilePolicyStore reads path and returns a store backed by its
+// contents.
+func NewJSONFilePolicyStore(path string) (*JSONFilePolicyStore, error) {
+	store := &JSONFilePolicyStore{path: path}
+	if err := store.Reload(); err != nil {
+		return nil, errors.Wrapf(err, "reading policy file '%s'", path)
+	}
+
+	return store, nil
+}
+
+// Reload re-reads and re-parses the underlying policy file.
+func (s *JSONFilePolicyStore) Reload() error {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	var policies []Policy
+	if err := json.Unmarshal(data, &policies); err != nil {
+		return errors.Wrap(err, "unmarshalling policy file")
+	}
+
+	s.mu.Lock()
+	s.policies = policies
+	s.mu.Unlock()
+
+	return nil
+}
+
+func (s *JSONFilePolicyStore) Policies() ([]Policy, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	out := make([]Policy, len(s.policies))
+	copy(out, s.policies)
+
+	return out, nil
+}
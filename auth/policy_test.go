@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPolicyMatches(t *testing.T) {
+	assert := assert.New(t)
+
+	p := &Policy{
+		ID:        "allow-admins",
+		Subjects:  []string{"admin"},
+		Resources: []string{"/api/*"},
+		Actions:   []string{"GET", "POST"},
+		Effect:    Allow,
+	}
+
+	assert.True(p.Matches([]string{"admin"}, "/api/users", "GET", "127.0.0.1:1234", time.Now()))
+	assert.False(p.Matches([]string{"viewer"}, "/api/users", "GET", "127.0.0.1:1234", time.Now()))
+	assert.False(p.Matches([]string{"admin"}, "/static/app.js", "GET", "127.0.0.1:1234", time.Now()))
+	assert.False(p.Matches([]string{"admin"}, "/api/users", "DELETE", "127.0.0.1:1234", time.Now()))
+}
+
+func TestPolicyMatchesNestedResource(t *testing.T) {
+	assert := assert.New(t)
+
+	p := &Policy{
+		ID:        "allow-admins",
+		Subjects:  []string{"admin"},
+		Resources: []string{"/api/*"},
+		Actions:   []string{"GET"},
+		Effect:    Allow,
+	}
+
+	assert.True(p.Matches([]string{"admin"}, "/api/v1/users", "GET", "127.0.0.1:1234", time.Now()))
+	assert.True(p.Matches([]string{"admin"}, "/api/v1/users/42/roles", "GET", "127.0.0.1:1234", time.Now()))
+	assert.True(p.Matches([]string{"admin"}, "/api", "GET", "127.0.0.1:1234", time.Now()))
+	assert.False(p.Matches([]string{"admin"}, "/apiary", "GET", "127.0.0.1:1234", time.Now()))
+}
+
+func TestPolicyMatchesIPCondition(t *testing.T) {
+	assert := assert.New(t)
+
+	p := &Policy{
+		Subjects:  []string{"*"},
+		Resources: []string{"*"},
+		Actions:   []string{"*"},
+		Effect:    Allow,
+		Condition: &Condition{IPRange: "10.0.0.0/8"},
+	}
+
+	assert.True(p.Matches([]string{"anyone"}, "/x", "GET", "10.1.2.3:5555", time.Now()))
+	assert.False(p.Matches([]string{"anyone"}, "/x", "GET", "192.168.1.1:5555", time.Now()))
+}
+
+func TestMemoryPolicyStore(t *testing.T) {
+	assert := assert.New(t)
+
+	store := NewMemoryPolicyStore([]Policy{{ID: "p1"}})
+	policies, err := store.Policies()
+	assert.NoError(err)
+	assert.Len(policies, 1)
+
+	store.SetPolicies([]Policy{{ID: "p1"}, {ID: "p2"}})
+	policies, err = store.Policies()
+	assert.NoError(err)
+	assert.Len(policies, 2)
+}
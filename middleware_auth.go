@@ -1,7 +1,9 @@
 package gimlet
 
 import (
+	"context"
 	"net/http"
+	"strings"
 
 	"github.com/evergreen-ci/gimlet/auth"
 	"github.com/mongodb/grip"
@@ -15,30 +17,116 @@ const (
 	requestIDKey contextKey = iota
 	loggerKey
 	startAtKey
+	correlationIDKey
+	loggingAnnotationsKey
 )
 
+// defaultAuthSchemes is the negotiator used by NewAuthenticationHandler
+// when it is called without an explicit providers map, populated via
+// RegisterAuthScheme.
+var defaultAuthSchemes = auth.NewSchemeNegotiator()
+
+// RegisterAuthScheme registers p as the provider for Authorization
+// header scheme name (for example "Bearer", "Basic", or "Signature",
+// compared case-insensitively), for use by calls to
+// NewAuthenticationHandler that don't supply an explicit providers
+// map. This lets independently initialized packages each contribute a
+// scheme to a shared default handler instead of requiring one place
+// in the application to assemble the full provider set.
+func RegisterAuthScheme(name string, p auth.Provider) {
+	defaultAuthSchemes.Register(name, p, auth.Challenge{Realm: "restricted"})
+}
+
 // NewAuthenticationHandler produces middleware that attaches
 // Authenticator and UserManager instances to the request context,
 // enabling the use of GetAuthenticator and GetUserManager accessors.
 //
-// While your application can have multiple authentication mechanisms,
-// a single request can only have one authentication provider
-// associated with it.
-func NewAuthenticationHandler(a auth.Provider) negroni.Handler {
-	return &authHandler{provider: a}
+// providers maps an Authorization header scheme name (for example
+// "Bearer", "Basic", or "Signature") to the auth.Provider that
+// handles it. The middleware reads the scheme token from the
+// request's Authorization header and attaches the matching
+// provider's Authenticator/UserManager to the context, so a single
+// route can accept token, basic, or signed-request clients
+// simultaneously. Passing a nil or empty map falls back to the
+// providers registered globally through RegisterAuthScheme.
+//
+// A request whose scheme has no matching provider is passed through
+// with no Authenticator/UserManager attached; GetAuthenticator and
+// GetUserManager will report ok=false downstream, so
+// NewRequireAuthHandler and NewAccessRequirement will reject it with
+// 401 and list every registered scheme's challenge in
+// WWW-Authenticate.
+func NewAuthenticationHandler(providers map[string]auth.Provider) negroni.Handler {
+	negotiator := defaultAuthSchemes
+	if len(providers) > 0 {
+		negotiator = auth.NewSchemeNegotiator()
+		for scheme, p := range providers {
+			negotiator.Register(scheme, p, auth.Challenge{Realm: "restricted"})
+		}
+	}
+
+	return &authHandler{negotiator: negotiator}
 }
 
 type authHandler struct {
-	provider auth.Provider
+	negotiator auth.ChallengeNegotiator
 }
 
 func (a *authHandler) ServeHTTP(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
 	ctx := r.Context()
-	ctx = auth.SetAuthenticator(ctx, a.provider.Authenticator())
-	ctx = auth.SetUserManager(ctx, a.provider.UserManager())
+	ctx = auth.SetChallengeNegotiator(ctx, a.negotiator)
 
-	r = r.WithContext(ctx)
-	next(rw, r)
+	if provider, ok := a.negotiator.ProviderForScheme(authHeaderScheme(r)); ok {
+		ctx = auth.SetAuthenticator(ctx, provider.Authenticator())
+		ctx = auth.SetUserManager(ctx, provider.UserManager())
+	}
+
+	next(rw, r.WithContext(ctx))
+}
+
+// authHeaderScheme extracts the scheme token (e.g. "Bearer") from a
+// request's Authorization header.
+func authHeaderScheme(r *http.Request) string {
+	scheme, _, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+	return scheme
+}
+
+// writeUnauthorized writes a 401 response, setting a combined
+// WWW-Authenticate header listing every scheme registered on ctx's
+// ChallengeNegotiator, if one was attached by NewAuthenticationHandler.
+func writeUnauthorized(ctx context.Context, rw http.ResponseWriter) {
+	if negotiator, ok := auth.GetChallengeNegotiator(ctx); ok {
+		if header := wwwAuthenticateHeader(negotiator.Challenges()); header != "" {
+			rw.Header().Set("WWW-Authenticate", header)
+		}
+	}
+
+	rw.WriteHeader(http.StatusUnauthorized)
+}
+
+func wwwAuthenticateHeader(challenges []auth.Challenge) string {
+	parts := make([]string, 0, len(challenges))
+	for _, c := range challenges {
+		if c.Scheme == "" {
+			continue
+		}
+
+		challenge := c.Scheme
+		params := make([]string, 0, len(c.Params)+1)
+		if c.Realm != "" {
+			params = append(params, `realm="`+c.Realm+`"`)
+		}
+		for k, v := range c.Params {
+			params = append(params, k+`="`+v+`"`)
+		}
+		if len(params) > 0 {
+			challenge += " " + strings.Join(params, ", ")
+		}
+
+		parts = append(parts, challenge)
+	}
+
+	return strings.Join(parts, ", ")
 }
 
 // NewAccessRequirement provides middlesware that requires a specific role to access a resource.
@@ -53,23 +141,24 @@ func (ra *requiredAccess) ServeHTTP(rw http.ResponseWriter, r *http.Request, nex
 
 	authenticator, ok := auth.GetAuthenticator(ctx)
 	if !ok {
-		rw.WriteHeader(http.StatusUnauthorized)
+		writeUnauthorized(ctx, rw)
 		return
 	}
 
 	userMgr, ok := auth.GetUserManager(ctx)
 	if !ok {
-		rw.WriteHeader(http.StatusUnauthorized)
+		writeUnauthorized(ctx, rw)
 		return
 	}
 
 	user, err := authenticator.GetUserFromRequest(userMgr, r)
 	if err != nil {
 		writeResponse(TEXT, rw, http.StatusUnauthorized, []byte(err.Error()))
+		return
 	}
 
 	if !authenticator.CheckGroupAccess(user, ra.role) {
-		rw.WriteHeader(http.StatusUnauthorized)
+		writeUnauthorized(ctx, rw)
 		return
 	}
 
@@ -97,23 +186,24 @@ func (_ *requireAuthHandler) ServeHTTP(rw http.ResponseWriter, r *http.Request,
 
 	authenticator, ok := auth.GetAuthenticator(ctx)
 	if !ok {
-		rw.WriteHeader(http.StatusUnauthorized)
+		writeUnauthorized(ctx, rw)
 		return
 	}
 
 	userMgr, ok := auth.GetUserManager(ctx)
 	if !ok {
-		rw.WriteHeader(http.StatusUnauthorized)
+		writeUnauthorized(ctx, rw)
 		return
 	}
 
 	user, err := authenticator.GetUserFromRequest(userMgr, r)
 	if err != nil {
 		writeResponse(TEXT, rw, http.StatusUnauthorized, []byte(err.Error()))
+		return
 	}
 
 	if !authenticator.CheckAuthenticated(user) {
-		rw.WriteHeader(http.StatusUnauthorized)
+		writeUnauthorized(ctx, rw)
 		return
 	}
 
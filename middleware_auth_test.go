@@ -0,0 +1,82 @@
+package gimlet
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/evergreen-ci/gimlet/auth"
+	"github.com/evergreen-ci/negroni"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+// erroringAuthenticator always fails GetUserFromRequest and panics if
+// CheckGroupAccess or CheckAuthenticated are reached, so tests that
+// use it catch any regression where a failed GetUserFromRequest falls
+// through into those calls instead of returning immediately.
+type erroringAuthenticator struct{}
+
+func (erroringAuthenticator) GetUserFromRequest(auth.UserManager, *http.Request) (auth.User, error) {
+	return nil, errors.New("bad credentials")
+}
+
+func (erroringAuthenticator) CheckAuthenticated(auth.User) bool {
+	panic("CheckAuthenticated should not be reached after GetUserFromRequest fails")
+}
+
+func (erroringAuthenticator) CheckGroupAccess(auth.User, string) bool {
+	panic("CheckGroupAccess should not be reached after GetUserFromRequest fails")
+}
+
+type noopUserManager struct{}
+
+func (noopUserManager) GetUserByID(id string) (auth.User, error)       { return nil, nil }
+func (noopUserManager) GetUserByToken(string) (auth.User, error)       { return nil, nil }
+func (noopUserManager) CreateUserToken(string, string) (string, error) { return "", nil }
+func (noopUserManager) GetOrCreateUser(u auth.User) (auth.User, error) { return u, nil }
+func (noopUserManager) ClearUser(auth.User, bool) error                { return nil }
+func (noopUserManager) GetLoginHandler(string) http.HandlerFunc        { return nil }
+func (noopUserManager) GetLogoutHandler(string) http.HandlerFunc       { return nil }
+func (noopUserManager) IsRedirect() bool                               { return false }
+
+func contextWithErroringAuthenticator() context.Context {
+	ctx := auth.SetAuthenticator(context.Background(), erroringAuthenticator{})
+	return auth.SetUserManager(ctx, noopUserManager{})
+}
+
+func TestRequiredAccessStopsAfterGetUserFromRequestError(t *testing.T) {
+	assert := assert.New(t)
+
+	handler := NewAccessRequirement("admin")
+
+	var called bool
+	next := func(http.ResponseWriter, *http.Request) { called = true }
+
+	req := (&http.Request{URL: &url.URL{}, Header: http.Header{}}).WithContext(contextWithErroringAuthenticator())
+	recorder := httptest.NewRecorder()
+	rw := negroni.NewResponseWriter(recorder)
+
+	assert.NotPanics(func() { handler.ServeHTTP(rw, req, next) })
+	assert.False(called)
+	assert.Equal(http.StatusUnauthorized, recorder.Code)
+}
+
+func TestRequireAuthHandlerStopsAfterGetUserFromRequestError(t *testing.T) {
+	assert := assert.New(t)
+
+	handler := NewRequireAuthHandler()
+
+	var called bool
+	next := func(http.ResponseWriter, *http.Request) { called = true }
+
+	req := (&http.Request{URL: &url.URL{}, Header: http.Header{}}).WithContext(contextWithErroringAuthenticator())
+	recorder := httptest.NewRecorder()
+	rw := negroni.NewResponseWriter(recorder)
+
+	assert.NotPanics(func() { handler.ServeHTTP(rw, req, next) })
+	assert.False(called)
+	assert.Equal(http.StatusUnauthorized, recorder.Code)
+}
@@ -0,0 +1,87 @@
+package gimlet
+
+import (
+	"net/http"
+
+	"github.com/evergreen-ci/gimlet/auth"
+	"github.com/mongodb/grip"
+	"github.com/mongodb/grip/message"
+	"github.com/urfave/negroni"
+)
+
+// NewBasicAuthHandler produces middleware that authenticates requests
+// carrying an "Authorization: Basic" header against store. On success
+// it attaches um to the context via auth.SetUserManager, the decoded
+// user via auth.SetUser, and an auth.Authenticator (auth.NewStaticAuthenticator)
+// that hands that same user back to anything calling GetUserFromRequest,
+// so that downstream NewAccessRequirement and NewRequireAuthHandler
+// middleware, which derive the user via the Authenticator rather than
+// reading auth.GetUser, see a fully authenticated user regardless of
+// which scheme produced it.
+//
+// A request that does not carry basic credentials is passed through
+// unauthenticated rather than rejected outright, so that this
+// middleware can be composed ahead of or behind provider-based
+// authentication on the same route; put NewRequireAuthHandler or
+// NewAccessRequirement after every scheme in the chain to enforce that
+// one of them succeeded. A request whose basic credentials fail
+// validation, or whose user lookup through um fails, is rejected with
+// a 401 carrying a `WWW-Authenticate: Basic realm="..."` challenge and
+// is not passed on.
+func NewBasicAuthHandler(store auth.BasicAuthStore, um auth.UserManager, realm string) negroni.Handler {
+	if realm == "" {
+		realm = "restricted"
+	}
+
+	return &basicAuthHandler{store: store, um: um, realm: realm}
+}
+
+type basicAuthHandler struct {
+	store auth.BasicAuthStore
+	um    auth.UserManager
+	realm string
+}
+
+func (h *basicAuthHandler) ServeHTTP(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		next(rw, r)
+		return
+	}
+
+	valid, err := h.store.Validate(username, password)
+	if err != nil {
+		grip.Warning(message.WrapError(err, message.Fields{
+			"message": "error validating basic auth credentials",
+			"user":    username,
+			"path":    r.URL.Path,
+		}))
+		h.challenge(rw)
+		return
+	}
+
+	if !valid {
+		h.challenge(rw)
+		return
+	}
+
+	user, err := h.um.GetUserByID(username)
+	if err != nil {
+		grip.Warning(message.WrapError(err, message.Fields{
+			"message": "basic auth credentials valid but user lookup failed",
+			"user":    username,
+		}))
+		h.challenge(rw)
+		return
+	}
+
+	ctx := auth.SetUserManager(r.Context(), h.um)
+	ctx = auth.SetUser(ctx, user)
+	ctx = auth.SetAuthenticator(ctx, auth.NewStaticAuthenticator(user))
+	next(rw, r.WithContext(ctx))
+}
+
+func (h *basicAuthHandler) challenge(rw http.ResponseWriter) {
+	rw.Header().Set("WWW-Authenticate", `Basic realm="`+h.realm+`"`)
+	rw.WriteHeader(http.StatusUnauthorized)
+}
@@ -0,0 +1,124 @@
+package gimlet
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/evergreen-ci/gimlet/auth"
+	"github.com/evergreen-ci/negroni"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func mustBcryptHash(password string) string {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		panic(err)
+	}
+
+	return string(hash)
+}
+
+// fakeBasicAuthUser and fakeBasicAuthUserManager are minimal auth.User
+// and auth.UserManager implementations used only to exercise
+// NewBasicAuthHandler in isolation.
+type fakeBasicAuthUser struct {
+	username string
+}
+
+func (u *fakeBasicAuthUser) Username() string        { return u.username }
+func (u *fakeBasicAuthUser) Roles() []string         { return nil }
+func (u *fakeBasicAuthUser) DisplayName() string     { return u.username }
+func (u *fakeBasicAuthUser) Email() string           { return "" }
+func (u *fakeBasicAuthUser) GetAPIKey() string       { return "" }
+func (u *fakeBasicAuthUser) GetAccessToken() string  { return "" }
+func (u *fakeBasicAuthUser) GetRefreshToken() string { return "" }
+
+type fakeBasicAuthUserManager struct{}
+
+func (m *fakeBasicAuthUserManager) GetUserByID(id string) (auth.User, error) {
+	return &fakeBasicAuthUser{username: id}, nil
+}
+func (m *fakeBasicAuthUserManager) GetUserByToken(string) (auth.User, error) { return nil, nil }
+func (m *fakeBasicAuthUserManager) CreateUserToken(string, string) (string, error) {
+	return "", nil
+}
+func (m *fakeBasicAuthUserManager) GetOrCreateUser(u auth.User) (auth.User, error) { return u, nil }
+func (m *fakeBasicAuthUserManager) ClearUser(auth.User, bool) error                { return nil }
+func (m *fakeBasicAuthUserManager) GetLoginHandler(string) http.HandlerFunc        { return nil }
+func (m *fakeBasicAuthUserManager) GetLogoutHandler(string) http.HandlerFunc       { return nil }
+func (m *fakeBasicAuthUserManager) IsRedirect() bool                               { return false }
+
+func TestBasicAuthHandlerAttachesAuthenticatorAndUser(t *testing.T) {
+	assert := assert.New(t)
+
+	store := auth.NewMemoryBasicAuthStore(nil)
+	store.SetUser("alice", mustBcryptHash("hunter2"))
+
+	handler := NewBasicAuthHandler(store, &fakeBasicAuthUserManager{}, "").(*basicAuthHandler)
+
+	var gotAuthenticator auth.Authenticator
+	var gotUserMgr auth.UserManager
+	var called bool
+	next := func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		gotAuthenticator, _ = auth.GetAuthenticator(r.Context())
+		gotUserMgr, _ = auth.GetUserManager(r.Context())
+	}
+
+	req := &http.Request{URL: &url.URL{}, Header: http.Header{}}
+	req.SetBasicAuth("alice", "hunter2")
+	rw := negroni.NewResponseWriter(httptest.NewRecorder())
+
+	handler.ServeHTTP(rw, req, next)
+
+	assert.True(called)
+	if assert.NotNil(gotAuthenticator) {
+		user, err := gotAuthenticator.GetUserFromRequest(gotUserMgr, req)
+		assert.NoError(err)
+		assert.Equal("alice", user.Username())
+		assert.True(gotAuthenticator.CheckAuthenticated(user))
+	}
+}
+
+func TestBasicAuthHandlerChallengesOnBadCredentials(t *testing.T) {
+	assert := assert.New(t)
+
+	store := auth.NewMemoryBasicAuthStore(nil)
+	store.SetUser("alice", mustBcryptHash("hunter2"))
+
+	handler := NewBasicAuthHandler(store, &fakeBasicAuthUserManager{}, "myrealm").(*basicAuthHandler)
+
+	var called bool
+	next := func(w http.ResponseWriter, r *http.Request) { called = true }
+
+	req := &http.Request{URL: &url.URL{}, Header: http.Header{}}
+	req.SetBasicAuth("alice", "wrong")
+	recorder := httptest.NewRecorder()
+	rw := negroni.NewResponseWriter(recorder)
+
+	handler.ServeHTTP(rw, req, next)
+
+	assert.False(called)
+	assert.Equal(http.StatusUnauthorized, recorder.Code)
+	assert.Contains(recorder.Header().Get("WWW-Authenticate"), "myrealm")
+}
+
+func TestBasicAuthHandlerPassesThroughWithoutCredentials(t *testing.T) {
+	assert := assert.New(t)
+
+	store := auth.NewMemoryBasicAuthStore(nil)
+	handler := NewBasicAuthHandler(store, &fakeBasicAuthUserManager{}, "").(*basicAuthHandler)
+
+	var called bool
+	next := func(w http.ResponseWriter, r *http.Request) { called = true }
+
+	req := &http.Request{URL: &url.URL{}, Header: http.Header{}}
+	rw := negroni.NewResponseWriter(httptest.NewRecorder())
+
+	handler.ServeHTTP(rw, req, next)
+
+	assert.True(called)
+}
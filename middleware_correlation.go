@@ -0,0 +1,110 @@
+package gimlet
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/urfave/negroni"
+)
+
+// DefaultCorrelationIDHeader is the header NewCorrelationIDHandler
+// reads an inbound correlation ID from when no header is specified;
+// DefaultCorrelationIDFallbackHeader is checked whenever that header
+// carries no value.
+const (
+	DefaultCorrelationIDHeader         = "X-Request-ID"
+	DefaultCorrelationIDFallbackHeader = "X-Correlation-ID"
+)
+
+// NewCorrelationIDHandler produces middleware that propagates a
+// correlation ID across process boundaries. If the inbound request
+// carries one on header (or, when it carries none there, on
+// DefaultCorrelationIDFallbackHeader), that value is reused for the
+// lifetime of the request; otherwise the numeric request ID assigned
+// by the logging middleware (GetRequestID), formatted as a string, is
+// used instead. Either way the ID is echoed back on the response under
+// header, and is made available to downstream code through
+// GetCorrelationID and HTTPClientFromContext.
+//
+// This middleware should run after the logging middleware produced by
+// NewAppLogger, since it relies on the request ID that middleware
+// assigns. It records the ID with AddLoggingAnnotation, so the
+// "completed" grip log line of NewAppLogger and NewRecoveryLogger
+// carries it as "correlation_id". Their "started" line is logged
+// before this middleware runs and does not carry it, nor do the panic
+// lines NewRecoveryLogger writes in place of "completed". Other code
+// that logs independently can read GetCorrelationID(ctx) itself.
+func NewCorrelationIDHandler(header string) negroni.Handler {
+	if header == "" {
+		header = DefaultCorrelationIDHeader
+	}
+
+	return &correlationIDHandler{header: header}
+}
+
+type correlationIDHandler struct {
+	header string
+}
+
+func (h *correlationIDHandler) ServeHTTP(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	ctx := r.Context()
+
+	id := r.Header.Get(h.header)
+	if id == "" {
+		id = r.Header.Get(DefaultCorrelationIDFallbackHeader)
+	}
+	if id == "" {
+		id = fmt.Sprintf("%d", GetRequestID(ctx))
+	}
+
+	ctx = context.WithValue(ctx, correlationIDKey, id)
+	AddLoggingAnnotation(r, "correlation_id", id)
+	rw.Header().Set(h.header, id)
+
+	next(rw, r.WithContext(ctx))
+}
+
+// GetCorrelationID returns the correlation ID attached to ctx by
+// NewCorrelationIDHandler, or the empty string if none is set.
+func GetCorrelationID(ctx context.Context) string {
+	id, _ := ctx.Value(correlationIDKey).(string)
+	return id
+}
+
+// HTTPClientFromContext returns an *http.Client that attaches the
+// correlation ID stored in ctx (if any) to every outbound request on
+// DefaultCorrelationIDHeader, so that calls to other gimlet-based
+// services can be traced back to the inbound request that triggered
+// them. If ctx has no correlation ID, the returned client behaves
+// like an ordinary *http.Client.
+func HTTPClientFromContext(ctx context.Context) *http.Client {
+	id := GetCorrelationID(ctx)
+	if id == "" {
+		return &http.Client{}
+	}
+
+	return &http.Client{
+		Transport: &correlationIDTransport{
+			header: DefaultCorrelationIDHeader,
+			id:     id,
+			base:   http.DefaultTransport,
+		},
+	}
+}
+
+// correlationIDTransport is an http.RoundTripper that stamps every
+// request with a fixed correlation ID header before delegating to
+// base.
+type correlationIDTransport struct {
+	header string
+	id     string
+	base   http.RoundTripper
+}
+
+func (t *correlationIDTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set(t.header, t.id)
+
+	return t.base.RoundTrip(req)
+}
@@ -0,0 +1,70 @@
+package gimlet
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/evergreen-ci/negroni"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCorrelationIDHandlerReusesInboundID(t *testing.T) {
+	assert := assert.New(t)
+
+	handler := NewCorrelationIDHandler("").(*correlationIDHandler)
+
+	var seen string
+	next := func(w http.ResponseWriter, r *http.Request) {
+		seen = GetCorrelationID(r.Context())
+	}
+
+	req := &http.Request{
+		URL:    &url.URL{},
+		Header: http.Header{DefaultCorrelationIDHeader: []string{"abc-123"}},
+	}
+	rw := negroni.NewResponseWriter(httptest.NewRecorder())
+
+	handler.ServeHTTP(rw, req, next)
+
+	assert.Equal("abc-123", seen)
+	assert.Equal("abc-123", rw.Header().Get(DefaultCorrelationIDHeader))
+}
+
+func TestCorrelationIDHandlerFallsBackToCorrelationHeader(t *testing.T) {
+	assert := assert.New(t)
+
+	handler := NewCorrelationIDHandler("").(*correlationIDHandler)
+
+	var seen string
+	next := func(w http.ResponseWriter, r *http.Request) {
+		seen = GetCorrelationID(r.Context())
+	}
+
+	req := &http.Request{
+		URL:    &url.URL{},
+		Header: http.Header{DefaultCorrelationIDFallbackHeader: []string{"xyz-789"}},
+	}
+	rw := negroni.NewResponseWriter(httptest.NewRecorder())
+
+	handler.ServeHTTP(rw, req, next)
+
+	assert.Equal("xyz-789", seen)
+}
+
+func TestGetCorrelationIDEmptyWhenUnset(t *testing.T) {
+	assert := assert.New(t)
+
+	req := &http.Request{URL: &url.URL{}}
+	assert.Equal("", GetCorrelationID(req.Context()))
+}
+
+func TestHTTPClientFromContextWithoutCorrelationID(t *testing.T) {
+	assert := assert.New(t)
+
+	req := &http.Request{URL: &url.URL{}}
+	client := HTTPClientFromContext(req.Context())
+	assert.NotNil(client)
+	assert.Nil(client.Transport)
+}
@@ -0,0 +1,237 @@
+package gimlet
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"github.com/mongodb/grip"
+	"github.com/mongodb/grip/logging"
+	"github.com/mongodb/grip/message"
+	"github.com/urfave/negroni"
+)
+
+var jobIDSource <-chan int
+
+func init() {
+	jobIDSource = func() <-chan int {
+		out := make(chan int, 50)
+		go func() {
+			var id int
+			for {
+				id++
+				out <- id
+			}
+		}()
+
+		return out
+	}()
+}
+
+// getNumber is a source of safe, monotonically increasing integers,
+// used both for request IDs and for the log-sequence number attached
+// to every "started" log line.
+func getNumber() int {
+	return <-jobIDSource
+}
+
+func setRequestID(r *http.Request, id int) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), requestIDKey, id))
+}
+
+// GetRequestID returns the unique, monotonically increasing ID
+// assigned to the request by the logging middleware, or -1 if the
+// request was not handled by NewAppLogger or NewRecoveryLogger.
+func GetRequestID(ctx context.Context) int {
+	if id, ok := ctx.Value(requestIDKey).(int); ok {
+		return id
+	}
+
+	return -1
+}
+
+func setStartAt(r *http.Request, startAt time.Time) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), startAtKey, startAt))
+}
+
+func getRequestStartAt(ctx context.Context) time.Time {
+	if startAt, ok := ctx.Value(startAtKey).(time.Time); ok {
+		return startAt
+	}
+
+	return time.Time{}
+}
+
+func setLogger(r *http.Request, logger grip.Journaler) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), loggerKey, logger))
+}
+
+// GetLogger returns the Journaler attached to the request by the
+// logging middleware. If no request is attached, or the request
+// wasn't handled by NewAppLogger or NewRecoveryLogger, it returns a
+// Journaler wrapping the default global grip sender.
+func GetLogger(ctx context.Context) grip.Journaler {
+	if logger, ok := ctx.Value(loggerKey).(grip.Journaler); ok {
+		return logger
+	}
+
+	return logging.MakeGrip(grip.GetSender())
+}
+
+// loggingAnnotations holds extra key/value pairs, attached to a
+// request by AddLoggingAnnotation, to merge into that request's
+// "completed" log line.
+type loggingAnnotations map[string]interface{}
+
+func setLoggingAnnotations(r *http.Request, annotations loggingAnnotations) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), loggingAnnotationsKey, annotations))
+}
+
+func getLoggingAnnotations(ctx context.Context) loggingAnnotations {
+	annotations, _ := ctx.Value(loggingAnnotationsKey).(loggingAnnotations)
+	return annotations
+}
+
+// AddLoggingAnnotation records key/value to be merged into the
+// "completed" log line that NewAppLogger or NewRecoveryLogger emits
+// for r. It is a no-op if r was not handled by one of those
+// middlewares, since there is then no annotations map attached to
+// merge into.
+func AddLoggingAnnotation(r *http.Request, key string, value interface{}) {
+	annotations := getLoggingAnnotations(r.Context())
+	if annotations == nil {
+		return
+	}
+
+	annotations[key] = value
+}
+
+// appLogging provides Negroni-compatible middleware that logs the
+// start and completion of every request using the grip packages,
+// defaulting to the global grip logging configuration.
+type appLogging struct {
+	grip.Journaler
+}
+
+// NewAppLogger creates a logging middleware instance suitable for use
+// with Negroni, using the same logging configuration as the default
+// global grip logging object.
+func NewAppLogger() negroni.Handler { return &appLogging{logging.MakeGrip(grip.GetSender())} }
+
+func (l *appLogging) ServeHTTP(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	r = setupLogger(l.Journaler, r)
+
+	next(rw, r)
+
+	finishLogger(l.Journaler, r, rw.(negroni.ResponseWriter))
+}
+
+// appRecoveryLogger is identical to appLogging, but also recovers from
+// panics in the downstream handler, logging them before responding
+// with a 500.
+type appRecoveryLogger struct {
+	grip.Journaler
+}
+
+// NewRecoveryLogger produces middleware, using j to log, that logs
+// request start and completion and recovers from panics, logging the
+// panic in place of the usual "completed" line.
+func NewRecoveryLogger(j grip.Journaler) negroni.Handler { return &appRecoveryLogger{Journaler: j} }
+
+func (l *appRecoveryLogger) ServeHTTP(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	r = setupLogger(l.Journaler, r)
+	ctx := r.Context()
+
+	defer func() {
+		err := recover()
+		if err == nil {
+			return
+		}
+
+		// Handlers panic with http.ErrAbortHandler to abort the
+		// request and suppress the net/http server's own panic
+		// logging; recognize it and log it quietly at Debug rather
+		// than as an alert.
+		if err == http.ErrAbortHandler {
+			l.Debug(message.Fields{
+				"message": "hit suppressed abort panic",
+				"action":  "aborted",
+				"request": GetRequestID(ctx),
+				"path":    r.URL.Path,
+				"remote":  r.RemoteAddr,
+			})
+			return
+		}
+
+		l.Alert(message.Fields{
+			"message": "hit panic in request handler",
+			"action":  "aborted",
+			"request": GetRequestID(ctx),
+			"path":    r.URL.Path,
+			"remote":  r.RemoteAddr,
+			"panic":   fmt.Sprintf("%v", err),
+			"stack":   string(debug.Stack()),
+		})
+
+		rw.WriteHeader(http.StatusInternalServerError)
+	}()
+
+	next(rw, r)
+
+	finishLogger(l.Journaler, r, rw.(negroni.ResponseWriter))
+}
+
+// setupLogger attaches logger, a fresh request ID, the request's
+// start time, and an empty annotations map to r, and logs the
+// request's "started" line before handing off to the next handler.
+func setupLogger(logger grip.Journaler, r *http.Request) *http.Request {
+	r = setLogger(r, logger)
+	r = setRequestID(r, getNumber())
+	r = setStartAt(r, time.Now())
+	r = setLoggingAnnotations(r, loggingAnnotations{})
+
+	ctx := r.Context()
+	fields := message.Fields{
+		"action":  "started",
+		"method":  r.Method,
+		"remote":  r.RemoteAddr,
+		"request": GetRequestID(ctx),
+		"path":    r.URL.Path,
+		"seq":     getNumber(),
+	}
+	if correlationID := GetCorrelationID(ctx); correlationID != "" {
+		fields["correlation_id"] = correlationID
+	}
+	logger.Info(fields)
+
+	return r
+}
+
+// finishLogger logs the "completed" line for r, merging in any
+// annotations attached during the request via AddLoggingAnnotation
+// and, when present on r's own context, the request's correlation ID
+// (see GetCorrelationID). NewCorrelationIDHandler records its ID as
+// such an annotation, so this line carries it as "correlation_id".
+func finishLogger(logger grip.Journaler, r *http.Request, res negroni.ResponseWriter) {
+	ctx := r.Context()
+
+	fields := message.Fields{
+		"action":      "completed",
+		"method":      r.Method,
+		"remote":      r.RemoteAddr,
+		"request":     GetRequestID(ctx),
+		"path":        r.URL.Path,
+		"duration_ms": int64(time.Since(getRequestStartAt(ctx)) / time.Millisecond),
+		"status":      res.Status(),
+	}
+	if correlationID := GetCorrelationID(ctx); correlationID != "" {
+		fields["correlation_id"] = correlationID
+	}
+	for key, value := range getLoggingAnnotations(ctx) {
+		fields[key] = value
+	}
+
+	logger.Info(fields)
+}
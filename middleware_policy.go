@@ -0,0 +1,117 @@
+package gimlet
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/evergreen-ci/gimlet/auth"
+	"github.com/mongodb/grip"
+	"github.com/mongodb/grip/message"
+	"github.com/urfave/negroni"
+)
+
+// NewPolicyRequirement produces middleware that authorizes requests
+// against store's Policy set, rather than the single required role
+// that NewAccessRequirement checks. Every policy in store is checked
+// against the request; a matching policy with Effect Deny always wins,
+// regardless of where it falls in the list, otherwise the request is
+// allowed if any policy matched with Effect Allow. A request that
+// matches no policy is denied. Because Deny always wins, the order of
+// policies in store has no effect on the outcome.
+func NewPolicyRequirement(store auth.PolicyStore) negroni.Handler {
+	return &policyRequirement{store: store}
+}
+
+type policyRequirement struct {
+	store auth.PolicyStore
+}
+
+func (p *policyRequirement) ServeHTTP(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	ctx := r.Context()
+
+	authenticator, ok := auth.GetAuthenticator(ctx)
+	if !ok {
+		writeUnauthorized(ctx, rw)
+		return
+	}
+
+	userMgr, ok := auth.GetUserManager(ctx)
+	if !ok {
+		writeUnauthorized(ctx, rw)
+		return
+	}
+
+	user, err := authenticator.GetUserFromRequest(userMgr, r)
+	if err != nil {
+		writeResponse(TEXT, rw, http.StatusUnauthorized, []byte(err.Error()))
+		return
+	}
+
+	policies, err := p.store.Policies()
+	if err != nil {
+		grip.Warning(message.WrapError(err, message.Fields{
+			"message": "failed to load policies",
+			"path":    r.URL.Path,
+			"request": GetRequestID(ctx),
+		}))
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	allowed, matchedID, reason := evaluatePolicies(policies, user, r)
+	if !allowed {
+		grip.Info(message.Fields{
+			"path":    r.URL.Path,
+			"remote":  r.RemoteAddr,
+			"request": GetRequestID(ctx),
+			"user":    user.Username(),
+			"message": "policy denied access",
+			"reason":  reason,
+		})
+		writeUnauthorized(ctx, rw)
+		return
+	}
+
+	grip.Info(message.Fields{
+		"path":      r.URL.Path,
+		"remote":    r.RemoteAddr,
+		"request":   GetRequestID(ctx),
+		"user":      user.Username(),
+		"policy_id": matchedID,
+	})
+
+	next(rw, r)
+}
+
+// evaluatePolicies walks policies in order and returns whether the
+// request is allowed, the ID of the policy that decided the outcome,
+// and, for a denial, a human-readable reason. An explicit Deny match
+// takes effect immediately; an Allow match is remembered but
+// evaluation continues so a later Deny can still override it.
+func evaluatePolicies(policies []auth.Policy, user auth.User, r *http.Request) (bool, string, string) {
+	subjects := append([]string{user.Username()}, user.Roles()...)
+	now := time.Now()
+
+	var allowedID string
+	allowed := false
+
+	for i := range policies {
+		policy := &policies[i]
+		if !policy.Matches(subjects, r.URL.Path, r.Method, r.RemoteAddr, now) {
+			continue
+		}
+
+		if policy.Effect == auth.Deny {
+			return false, policy.ID, "explicit deny from policy " + policy.ID
+		}
+
+		allowed = true
+		allowedID = policy.ID
+	}
+
+	if !allowed {
+		return false, "", "no policy matched"
+	}
+
+	return true, allowedID, ""
+}
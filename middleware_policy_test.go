@@ -0,0 +1,135 @@
+package gimlet
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/evergreen-ci/gimlet/auth"
+	"github.com/evergreen-ci/negroni"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEvaluatePoliciesAllowMatch(t *testing.T) {
+	assert := assert.New(t)
+
+	policies := []auth.Policy{
+		{ID: "allow-admins", Subjects: []string{"admin"}, Resources: []string{"*"}, Actions: []string{"*"}, Effect: auth.Allow},
+	}
+	user := &fakeBasicAuthUser{username: "admin"}
+	r := &http.Request{Method: "GET", URL: &url.URL{Path: "/api/users"}}
+
+	allowed, matchedID, reason := evaluatePolicies(policies, user, r)
+	assert.True(allowed)
+	assert.Equal("allow-admins", matchedID)
+	assert.Empty(reason)
+}
+
+func TestEvaluatePoliciesNoMatchDenies(t *testing.T) {
+	assert := assert.New(t)
+
+	policies := []auth.Policy{
+		{ID: "allow-admins", Subjects: []string{"admin"}, Resources: []string{"*"}, Actions: []string{"*"}, Effect: auth.Allow},
+	}
+	user := &fakeBasicAuthUser{username: "viewer"}
+	r := &http.Request{Method: "GET", URL: &url.URL{Path: "/api/users"}}
+
+	allowed, matchedID, reason := evaluatePolicies(policies, user, r)
+	assert.False(allowed)
+	assert.Empty(matchedID)
+	assert.Equal("no policy matched", reason)
+}
+
+func TestEvaluatePoliciesDenyOverridesLaterAllow(t *testing.T) {
+	assert := assert.New(t)
+
+	policies := []auth.Policy{
+		{ID: "deny-write", Subjects: []string{"*"}, Resources: []string{"*"}, Actions: []string{"DELETE"}, Effect: auth.Deny},
+		{ID: "allow-all", Subjects: []string{"*"}, Resources: []string{"*"}, Actions: []string{"*"}, Effect: auth.Allow},
+	}
+	user := &fakeBasicAuthUser{username: "admin"}
+	r := &http.Request{Method: "DELETE", URL: &url.URL{Path: "/api/users"}}
+
+	allowed, matchedID, reason := evaluatePolicies(policies, user, r)
+	assert.False(allowed)
+	assert.Equal("deny-write", matchedID)
+	assert.Equal("explicit deny from policy deny-write", reason)
+}
+
+func TestEvaluatePoliciesFirstDenyWins(t *testing.T) {
+	assert := assert.New(t)
+
+	policies := []auth.Policy{
+		{ID: "deny-first", Subjects: []string{"*"}, Resources: []string{"*"}, Actions: []string{"*"}, Effect: auth.Deny},
+		{ID: "deny-second", Subjects: []string{"*"}, Resources: []string{"*"}, Actions: []string{"*"}, Effect: auth.Deny},
+	}
+	user := &fakeBasicAuthUser{username: "admin"}
+	r := &http.Request{Method: "GET", URL: &url.URL{Path: "/api/users"}}
+
+	allowed, matchedID, _ := evaluatePolicies(policies, user, r)
+	assert.False(allowed)
+	assert.Equal("deny-first", matchedID)
+}
+
+func TestPolicyRequirementAllowsMatchingRequest(t *testing.T) {
+	assert := assert.New(t)
+
+	store := auth.NewMemoryPolicyStore([]auth.Policy{
+		{ID: "allow-admins", Subjects: []string{"admin"}, Resources: []string{"*"}, Actions: []string{"*"}, Effect: auth.Allow},
+	})
+	handler := NewPolicyRequirement(store)
+
+	user := &fakeBasicAuthUser{username: "admin"}
+	ctx := auth.SetAuthenticator(context.Background(), auth.NewStaticAuthenticator(user))
+	ctx = auth.SetUserManager(ctx, &fakeBasicAuthUserManager{})
+
+	req := (&http.Request{URL: &url.URL{Path: "/api/users"}, Method: "GET"}).WithContext(ctx)
+	rw := negroni.NewResponseWriter(httptest.NewRecorder())
+
+	var called bool
+	handler.ServeHTTP(rw, req, func(http.ResponseWriter, *http.Request) { called = true })
+
+	assert.True(called)
+}
+
+func TestPolicyRequirementDeniesNonMatchingRequest(t *testing.T) {
+	assert := assert.New(t)
+
+	store := auth.NewMemoryPolicyStore([]auth.Policy{
+		{ID: "allow-admins", Subjects: []string{"admin"}, Resources: []string{"*"}, Actions: []string{"*"}, Effect: auth.Allow},
+	})
+	handler := NewPolicyRequirement(store)
+
+	user := &fakeBasicAuthUser{username: "viewer"}
+	ctx := auth.SetAuthenticator(context.Background(), auth.NewStaticAuthenticator(user))
+	ctx = auth.SetUserManager(ctx, &fakeBasicAuthUserManager{})
+
+	req := (&http.Request{URL: &url.URL{Path: "/api/users"}, Method: "GET"}).WithContext(ctx)
+	recorder := httptest.NewRecorder()
+	rw := negroni.NewResponseWriter(recorder)
+
+	var called bool
+	handler.ServeHTTP(rw, req, func(http.ResponseWriter, *http.Request) { called = true })
+
+	assert.False(called)
+	assert.Equal(http.StatusUnauthorized, recorder.Code)
+}
+
+func TestPolicyRequirementMissingAuthenticatorChallenges(t *testing.T) {
+	assert := assert.New(t)
+
+	store := auth.NewMemoryPolicyStore(nil)
+	handler := NewPolicyRequirement(store)
+
+	req := &http.Request{URL: &url.URL{Path: "/api/users"}, Method: "GET"}
+	recorder := httptest.NewRecorder()
+	rw := negroni.NewResponseWriter(recorder)
+
+	var called bool
+	handler.ServeHTTP(rw, req, func(http.ResponseWriter, *http.Request) { called = true })
+
+	assert.False(called)
+	assert.Equal(http.StatusUnauthorized, recorder.Code)
+}
@@ -0,0 +1,379 @@
+package gimlet
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/evergreen-ci/gimlet/auth"
+	"github.com/mongodb/grip"
+	"github.com/mongodb/grip/message"
+	"github.com/urfave/negroni"
+)
+
+// RateLimitKeyFunc extracts the dimension a rate limit is keyed on
+// (for example a remote IP or username) from a request.
+type RateLimitKeyFunc func(r *http.Request) string
+
+// RateLimitConfig configures NewRateLimitHandler.
+type RateLimitConfig struct {
+	// Store holds token-bucket state between requests. Defaults to a
+	// NewMemoryRateLimitStore if nil.
+	Store RateLimitStore
+
+	// KeyFunc extracts the key a request's bucket is looked up by.
+	// Defaults to RateLimitByRemoteIP.
+	KeyFunc RateLimitKeyFunc
+
+	// Rate is the number of tokens added to a bucket per second.
+	Rate float64
+
+	// Burst is the maximum number of tokens a bucket can hold, and
+	// therefore the largest burst of requests a single key can make
+	// before being throttled.
+	Burst float64
+
+	// IdleTimeout bounds how long a bucket may go unused before a
+	// Store is allowed to evict it. Defaults to 10 minutes.
+	IdleTimeout time.Duration
+
+	// RouteOverrides maps a request path prefix to a RateLimitConfig
+	// whose Rate, Burst, and KeyFunc (where set) replace this
+	// config's for requests under that prefix. The longest matching
+	// prefix wins.
+	RouteOverrides map[string]RateLimitConfig
+}
+
+// RateLimitByRemoteIP keys on the request's remote IP, preferring the
+// left-most address in X-Forwarded-For when present.
+func RateLimitByRemoteIP(r *http.Request) string {
+	if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+		if addr := strings.TrimSpace(strings.Split(fwd, ",")[0]); addr != "" {
+			return addr
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+// RateLimitByUser keys on the authenticated username attached to the
+// request context by NewAuthenticationHandler, falling back to
+// RateLimitByRemoteIP for unauthenticated requests.
+func RateLimitByUser(r *http.Request) string {
+	ctx := r.Context()
+
+	authenticator, ok := auth.GetAuthenticator(ctx)
+	if !ok {
+		return RateLimitByRemoteIP(r)
+	}
+
+	userMgr, ok := auth.GetUserManager(ctx)
+	if !ok {
+		return RateLimitByRemoteIP(r)
+	}
+
+	user, err := authenticator.GetUserFromRequest(userMgr, r)
+	if err != nil || user == nil {
+		return RateLimitByRemoteIP(r)
+	}
+
+	return user.Username()
+}
+
+// NewRateLimitHandler produces negroni middleware that applies
+// token-bucket rate limiting keyed on cfg.KeyFunc. On each request,
+// the bucket for the request's key is refilled by rate tokens/sec up
+// to a maximum of burst, then a single token is deducted if one is
+// available; once a key's bucket is empty the connection is closed
+// after writing a 429 with Retry-After and X-RateLimit-* headers.
+func NewRateLimitHandler(cfg RateLimitConfig) negroni.Handler {
+	if cfg.Store == nil {
+		cfg.Store = NewMemoryRateLimitStore(cfg.IdleTimeout)
+	}
+	if cfg.KeyFunc == nil {
+		cfg.KeyFunc = RateLimitByRemoteIP
+	}
+
+	return &rateLimitHandler{cfg: cfg}
+}
+
+type rateLimitHandler struct {
+	cfg RateLimitConfig
+}
+
+func (h *rateLimitHandler) ServeHTTP(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	cfg := h.configFor(r.URL.Path)
+	key := cfg.KeyFunc(r)
+
+	rw.Header().Set("X-RateLimit-Limit", strconv.FormatFloat(cfg.Burst, 'f', -1, 64))
+
+	if h.cfg.Store.Allow(key, cfg.Rate, cfg.Burst) {
+		next(rw, r)
+		return
+	}
+
+	retryAfter := 1
+	if cfg.Rate > 0 {
+		retryAfter = int(math.Ceil(1 / cfg.Rate))
+	}
+
+	grip.Info(message.Fields{
+		"message": "rate limit exceeded",
+		"path":    r.URL.Path,
+		"remote":  r.RemoteAddr,
+		"request": GetRequestID(r.Context()),
+		"key":     key,
+	})
+
+	rw.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	rw.Header().Set("X-RateLimit-Remaining", "0")
+	writeResponse(TEXT, rw, http.StatusTooManyRequests, []byte("rate limit exceeded"))
+
+	if hj, ok := rw.(http.Hijacker); ok {
+		if conn, _, err := hj.Hijack(); err == nil {
+			conn.Close()
+		}
+	}
+}
+
+// configFor returns h.cfg with Rate, Burst, and KeyFunc replaced by
+// those of the longest RouteOverrides prefix matching path, if any.
+func (h *rateLimitHandler) configFor(path string) RateLimitConfig {
+	cfg := h.cfg
+
+	var best RateLimitConfig
+	bestLen := -1
+	for prefix, override := range h.cfg.RouteOverrides {
+		if !strings.HasPrefix(path, prefix) || len(prefix) <= bestLen {
+			continue
+		}
+
+		best, bestLen = override, len(prefix)
+	}
+	if bestLen < 0 {
+		return cfg
+	}
+
+	if best.Rate > 0 {
+		cfg.Rate = best.Rate
+	}
+	if best.Burst > 0 {
+		cfg.Burst = best.Burst
+	}
+	if best.KeyFunc != nil {
+		cfg.KeyFunc = best.KeyFunc
+	}
+
+	return cfg
+}
+
+// RateLimitStore tracks token-bucket state for rate-limited keys.
+type RateLimitStore interface {
+	// Allow reports whether a request for key should be permitted
+	// under a token bucket that refills at rate tokens/sec up to a
+	// maximum of burst tokens, consuming one token if so.
+	Allow(key string, rate, burst float64) bool
+
+	// Close stops any background maintenance (such as idle-bucket
+	// eviction) started by the store.
+	Close()
+}
+
+// tokenBucket is the token-bucket state for a single rate-limited
+// key: tokens is refilled lazily on each take, at up to burst tokens,
+// by rate*elapsed seconds since lastRefill.
+type tokenBucket struct {
+	mu         sync.Mutex
+	tokens     float64
+	lastRefill time.Time
+	lastUsed   time.Time
+}
+
+func (b *tokenBucket) take(rate, burst float64, now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if elapsed := now.Sub(b.lastRefill).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(burst, b.tokens+elapsed*rate)
+		b.lastRefill = now
+	}
+	b.lastUsed = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true
+	}
+
+	return false
+}
+
+// MemoryRateLimitStore is a RateLimitStore backed by an in-memory map
+// of token buckets, with a background goroutine that evicts buckets
+// idle for longer than idleTimeout to bound memory under an unbounded
+// key space (for example, one bucket per client IP).
+type MemoryRateLimitStore struct {
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+
+	idleTimeout time.Duration
+	stop        chan struct{}
+	stopOnce    sync.Once
+}
+
+// NewMemoryRateLimitStore returns a MemoryRateLimitStore whose
+// background eviction sweep runs every idleTimeout, removing buckets
+// unused since the previous sweep. idleTimeout defaults to 10 minutes
+// when zero or negative.
+func NewMemoryRateLimitStore(idleTimeout time.Duration) *MemoryRateLimitStore {
+	if idleTimeout <= 0 {
+		idleTimeout = 10 * time.Minute
+	}
+
+	s := &MemoryRateLimitStore{
+		buckets:     map[string]*tokenBucket{},
+		idleTimeout: idleTimeout,
+		stop:        make(chan struct{}),
+	}
+
+	go s.evictLoop()
+
+	return s
+}
+
+func (s *MemoryRateLimitStore) Allow(key string, rate, burst float64) bool {
+	now := time.Now()
+
+	s.mu.Lock()
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: burst, lastRefill: now, lastUsed: now}
+		s.buckets[key] = b
+	}
+	s.mu.Unlock()
+
+	return b.take(rate, burst, now)
+}
+
+func (s *MemoryRateLimitStore) evictLoop() {
+	ticker := time.NewTicker(s.idleTimeout)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.evict(time.Now().Add(-s.idleTimeout))
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+func (s *MemoryRateLimitStore) evict(cutoff time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, b := range s.buckets {
+		b.mu.Lock()
+		idle := b.lastUsed.Before(cutoff)
+		b.mu.Unlock()
+
+		if idle {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+// Close stops the background eviction goroutine. It is safe to call
+// more than once.
+func (s *MemoryRateLimitStore) Close() {
+	s.stopOnce.Do(func() { close(s.stop) })
+}
+
+// RedisClient is the minimal surface NewRedisRateLimitStore needs from
+// a Redis client, so that callers can plug in whichever client
+// library their application already depends on.
+type RedisClient interface {
+	Get(key string) (string, error)
+	Set(key, value string, ttl time.Duration) error
+}
+
+// RedisRateLimitStore is a RateLimitStore backed by Redis, for rate
+// limiting shared across a fleet of instances. Each bucket's encoded
+// state is stored under prefix+key with a TTL of idleTimeout, which
+// both bounds memory in Redis and gives idle eviction for free; Close
+// is a no-op since there is no local background goroutine to stop.
+//
+// The read-refill-write sequence in Allow is not atomic across
+// concurrent requests for the same key; under heavy concurrent load
+// for a single key this can admit slightly more than burst requests.
+// Production deployments that need exact enforcement should replace
+// Allow's body with a Lua script evaluated server-side.
+type RedisRateLimitStore struct {
+	client      RedisClient
+	prefix      string
+	idleTimeout time.Duration
+}
+
+// NewRedisRateLimitStore returns a RateLimitStore backed by client,
+// storing bucket state under keys prefixed with prefix.
+func NewRedisRateLimitStore(client RedisClient, prefix string, idleTimeout time.Duration) *RedisRateLimitStore {
+	if idleTimeout <= 0 {
+		idleTimeout = 10 * time.Minute
+	}
+
+	return &RedisRateLimitStore{client: client, prefix: prefix, idleTimeout: idleTimeout}
+}
+
+func (s *RedisRateLimitStore) Allow(key string, rate, burst float64) bool {
+	now := time.Now()
+
+	tokens, lastRefill := burst, now
+	if raw, err := s.client.Get(s.prefix + key); err == nil && raw != "" {
+		tokens, lastRefill = decodeBucketState(raw)
+	}
+
+	if elapsed := now.Sub(lastRefill).Seconds(); elapsed > 0 {
+		tokens = math.Min(burst, tokens+elapsed*rate)
+	}
+
+	allow := tokens >= 1
+	if allow {
+		tokens--
+	}
+
+	if err := s.client.Set(s.prefix+key, encodeBucketState(tokens, now), s.idleTimeout); err != nil {
+		grip.Warning(message.WrapError(err, message.Fields{
+			"message": "failed to persist rate limit bucket state",
+			"key":     key,
+		}))
+	}
+
+	return allow
+}
+
+func (s *RedisRateLimitStore) Close() {}
+
+func encodeBucketState(tokens float64, lastRefill time.Time) string {
+	return strconv.FormatFloat(tokens, 'f', -1, 64) + "|" + strconv.FormatInt(lastRefill.UnixNano(), 10)
+}
+
+func decodeBucketState(raw string) (float64, time.Time) {
+	parts := strings.SplitN(raw, "|", 2)
+	if len(parts) != 2 {
+		return 0, time.Now()
+	}
+
+	tokens, _ := strconv.ParseFloat(parts[0], 64)
+	nanos, _ := strconv.ParseInt(parts[1], 10, 64)
+
+	return tokens, time.Unix(0, nanos)
+}
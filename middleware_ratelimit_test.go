@@ -0,0 +1,117 @@
+package gimlet
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/evergreen-ci/negroni"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryRateLimitStoreAllowsWithinBurst(t *testing.T) {
+	assert := assert.New(t)
+
+	store := NewMemoryRateLimitStore(time.Minute)
+	defer store.Close()
+
+	for i := 0; i < 3; i++ {
+		assert.True(store.Allow("client", 1, 3), "request %d should be allowed", i)
+	}
+	assert.False(store.Allow("client", 1, 3), "burst should be exhausted")
+}
+
+func TestMemoryRateLimitStoreRefillsOverTime(t *testing.T) {
+	assert := assert.New(t)
+
+	store := NewMemoryRateLimitStore(time.Minute)
+	defer store.Close()
+
+	b := &tokenBucket{tokens: 0, lastRefill: time.Now().Add(-2 * time.Second)}
+	assert.True(b.take(1, 5, time.Now()))
+}
+
+func TestMemoryRateLimitStoreEvictsIdleBuckets(t *testing.T) {
+	assert := assert.New(t)
+
+	store := NewMemoryRateLimitStore(time.Minute)
+	defer store.Close()
+
+	store.Allow("client", 1, 1)
+	store.evict(time.Now().Add(time.Minute))
+
+	store.mu.Lock()
+	_, ok := store.buckets["client"]
+	store.mu.Unlock()
+	assert.False(ok)
+}
+
+func TestRateLimitByRemoteIPPrefersForwardedFor(t *testing.T) {
+	assert := assert.New(t)
+
+	req := &http.Request{
+		RemoteAddr: "10.0.0.1:1234",
+		Header:     http.Header{"X-Forwarded-For": []string{"1.2.3.4, 10.0.0.1"}},
+	}
+	assert.Equal("1.2.3.4", RateLimitByRemoteIP(req))
+}
+
+func TestRateLimitHandlerAllowsWithinBurst(t *testing.T) {
+	assert := assert.New(t)
+
+	handler := NewRateLimitHandler(RateLimitConfig{Rate: 1, Burst: 1})
+
+	req := &http.Request{RemoteAddr: "10.0.0.1:1234", URL: &url.URL{Path: "/api/users"}, Header: http.Header{}}
+	recorder := httptest.NewRecorder()
+	rw := negroni.NewResponseWriter(recorder)
+
+	var called bool
+	handler.ServeHTTP(rw, req, func(http.ResponseWriter, *http.Request) { called = true })
+
+	assert.True(called)
+	assert.Equal("1", recorder.Header().Get("X-RateLimit-Limit"))
+}
+
+func TestRateLimitHandlerBreachReturns429WithHeaders(t *testing.T) {
+	assert := assert.New(t)
+
+	handler := NewRateLimitHandler(RateLimitConfig{Rate: 1, Burst: 1})
+
+	newReq := func() *http.Request {
+		return &http.Request{RemoteAddr: "10.0.0.1:1234", URL: &url.URL{Path: "/api/users"}, Header: http.Header{}}
+	}
+	noop := func(http.ResponseWriter, *http.Request) {}
+
+	// Exhaust the single burst token.
+	handler.ServeHTTP(negroni.NewResponseWriter(httptest.NewRecorder()), newReq(), noop)
+
+	var called bool
+	recorder := httptest.NewRecorder()
+	rw := negroni.NewResponseWriter(recorder)
+	handler.ServeHTTP(rw, newReq(), func(http.ResponseWriter, *http.Request) { called = true })
+
+	assert.False(called, "next should not be called once the bucket is exhausted")
+	assert.Equal(http.StatusTooManyRequests, recorder.Code)
+	assert.Equal("1", recorder.Header().Get("Retry-After"))
+	assert.Equal("0", recorder.Header().Get("X-RateLimit-Remaining"))
+	assert.Equal("1", recorder.Header().Get("X-RateLimit-Limit"))
+}
+
+func TestRateLimitHandlerRouteOverridesByLongestPrefix(t *testing.T) {
+	assert := assert.New(t)
+
+	handler := NewRateLimitHandler(RateLimitConfig{
+		Rate:  1,
+		Burst: 5,
+		RouteOverrides: map[string]RateLimitConfig{
+			"/api":        {Rate: 1, Burst: 2},
+			"/api/admin/": {Rate: 1, Burst: 1},
+		},
+	}).(*rateLimitHandler)
+
+	assert.Equal(float64(1), handler.configFor("/api/admin/users").Burst)
+	assert.Equal(float64(2), handler.configFor("/api/users").Burst)
+	assert.Equal(float64(5), handler.configFor("/other").Burst)
+}